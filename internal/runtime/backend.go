@@ -0,0 +1,80 @@
+// Package runtime abstracts over the container runtime a checkpoint/restore
+// operation targets, so the CRIU-driving code in main doesn't have to
+// hard-code the Docker daemon.
+package runtime
+
+import (
+	"fmt"
+	"path/filepath"
+)
+
+// ContainerInfo is the runtime-agnostic view of a container that the
+// checkpoint/restore pipeline operates on. Config and HostConfig carry
+// whatever backend-specific configuration the container was created with
+// (Docker's container.Config/HostConfig, a containerd task spec, ...); only
+// the backend that produced them knows how to interpret them, so they ride
+// along as opaque values.
+type ContainerInfo struct {
+	ID         string
+	Name       string
+	PID        int
+	State      string
+	RootFS     string
+	Runtime    string
+	BundlePath string
+	Namespaces map[string]string
+	CgroupPath string
+	// UsernsMode mirrors Docker's HostConfig.UsernsMode ("host", "private",
+	// or a shared-namespace reference); empty for backends that don't have
+	// an equivalent concept.
+	UsernsMode string
+	Config     interface{}
+	HostConfig interface{}
+}
+
+// Backend is implemented once per supported container runtime. It covers
+// everything the checkpoint/restore flow needs beyond CRIU itself: finding
+// the container, recreating a stopped placeholder to restore into, and
+// telling the runtime about the checkpoint/restore so it can update its own
+// bookkeeping (e.g. Docker's container state, containerd's task status).
+type Backend interface {
+	// Inspect resolves name (container name or ID) to a ContainerInfo.
+	Inspect(name string) (*ContainerInfo, error)
+	// CreateForRestore creates a new, not-yet-started container named new,
+	// configured the same way as orig, ready for CRIU to restore into.
+	CreateForRestore(orig, new string) error
+	// NotifyCheckpointComplete tells the runtime that id has been
+	// checkpointed, so it can reconcile its view of the container's state.
+	NotifyCheckpointComplete(id string) error
+	// NotifyRestoreComplete tells the runtime that id has been restored and
+	// is now running as pid.
+	NotifyRestoreComplete(id string, pid int) error
+}
+
+// resolveRootFS turns an OCI runtime-spec root.path into an absolute path.
+// The spec allows root.path to be relative to the bundle directory (and
+// most runc/crun bundles use the relative form "rootfs"), so backends that
+// read config.json directly need to join it against bundlePath rather than
+// handing it to CRIU's Root option as-is.
+func resolveRootFS(bundlePath, rootPath string) string {
+	if filepath.IsAbs(rootPath) {
+		return rootPath
+	}
+	return filepath.Join(bundlePath, rootPath)
+}
+
+// Select returns the Backend implementation named by backend. An empty
+// string selects the Docker backend, matching the tool's original
+// behavior.
+func Select(backend string) (Backend, error) {
+	switch backend {
+	case "", "docker":
+		return NewDockerBackend(), nil
+	case "containerd":
+		return NewContainerdBackend()
+	case "runc":
+		return NewRuncBackend(), nil
+	default:
+		return nil, fmt.Errorf("unknown runtime backend %q (want docker, containerd, or runc)", backend)
+	}
+}
@@ -0,0 +1,134 @@
+package runtime
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+
+	containerd "github.com/containerd/containerd"
+	"github.com/containerd/containerd/errdefs"
+	"github.com/containerd/containerd/namespaces"
+)
+
+// containerdSocket and containerdNamespace match containerd's own CLI
+// defaults, so this backend works out of the box against a stock
+// installation (including the containerd instance backing a Kubernetes
+// node via CRI).
+const (
+	containerdSocket    = "/run/containerd/containerd.sock"
+	containerdNamespace = "default"
+)
+
+// ContainerdBackend drives checkpoint/restore against containerd. It builds
+// the on-disk bundle path from containerd's v2 task runtime layout
+// (/run/containerd/io.containerd.runtime.v2.task/<namespace>/<id>) rather
+// than Docker's moby layout; the path is not read from the task itself. This
+// is what lets the tool checkpoint/restore
+// Kubernetes pod containers, which run under containerd/CRI rather than the
+// Docker daemon.
+type ContainerdBackend struct {
+	client *containerd.Client
+}
+
+// NewContainerdBackend connects to the local containerd daemon.
+func NewContainerdBackend() (*ContainerdBackend, error) {
+	client, err := containerd.New(containerdSocket)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to containerd at %s: %w", containerdSocket, err)
+	}
+	return &ContainerdBackend{client: client}, nil
+}
+
+func (b *ContainerdBackend) ctx() context.Context {
+	return namespaces.WithNamespace(context.Background(), containerdNamespace)
+}
+
+func (b *ContainerdBackend) Inspect(name string) (*ContainerInfo, error) {
+	ctx := b.ctx()
+
+	container, err := b.client.LoadContainer(ctx, name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load container %q: %w", name, err)
+	}
+
+	spec, err := container.Spec(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load OCI spec: %w", err)
+	}
+
+	bundlePath := filepath.Join("/run/containerd/io.containerd.runtime.v2.task", containerdNamespace, name)
+
+	// restoreContainer calls CreateForRestore then immediately Inspect to
+	// get the placeholder it just made CRIU can restore into; that
+	// placeholder has no task yet, so a missing task is expected here, not
+	// an error - it just means PID 0 / "not running", same as the Docker
+	// backend reports for a stopped container.
+	task, err := container.Task(ctx, nil)
+	var pid int
+	state := "created"
+	if err != nil {
+		if !errdefs.IsNotFound(err) {
+			return nil, fmt.Errorf("failed to load task for container %q: %w", name, err)
+		}
+	} else {
+		status, err := task.Status(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get task status: %w", err)
+		}
+		pid = int(task.Pid())
+		state = string(status.Status)
+	}
+
+	info := &ContainerInfo{
+		ID:         container.ID(),
+		Name:       name,
+		PID:        pid,
+		State:      state,
+		RootFS:     resolveRootFS(bundlePath, spec.Root.Path),
+		Runtime:    "containerd",
+		BundlePath: bundlePath,
+		Namespaces: make(map[string]string),
+		Config:     spec,
+	}
+
+	if pid != 0 {
+		for _, ns := range []string{"ipc", "mnt", "net", "pid", "user", "uts", "cgroup"} {
+			info.Namespaces[ns] = fmt.Sprintf("/proc/%d/ns/%s", pid, ns)
+		}
+	}
+
+	return info, nil
+}
+
+func (b *ContainerdBackend) CreateForRestore(orig, new string) error {
+	ctx := b.ctx()
+
+	origContainer, err := b.client.LoadContainer(ctx, orig)
+	if err != nil {
+		return fmt.Errorf("original container %q not found: %w", orig, err)
+	}
+
+	spec, err := origContainer.Spec(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to load OCI spec for %q: %w", orig, err)
+	}
+
+	_, err = b.client.NewContainer(ctx, new, containerd.WithSpec(spec))
+	if err != nil {
+		return fmt.Errorf("failed to create container %q: %w", new, err)
+	}
+
+	return nil
+}
+
+// NotifyCheckpointComplete is a no-op: containerd learns a task has exited
+// (or is still running, with -leave-running) through its normal task event
+// stream.
+func (b *ContainerdBackend) NotifyCheckpointComplete(id string) error {
+	return nil
+}
+
+// NotifyRestoreComplete is a no-op for the same reason.
+func (b *ContainerdBackend) NotifyRestoreComplete(id string, pid int) error {
+	return nil
+}
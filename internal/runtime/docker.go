@@ -0,0 +1,129 @@
+package runtime
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/client"
+)
+
+// DockerBackend drives checkpoint/restore against the Docker daemon. It
+// reproduces the behavior the tool had before the Backend abstraction
+// existed.
+type DockerBackend struct{}
+
+// NewDockerBackend returns a Backend backed by the local Docker daemon
+// (resolved via the standard DOCKER_HOST / TLS environment variables).
+func NewDockerBackend() *DockerBackend {
+	return &DockerBackend{}
+}
+
+func (b *DockerBackend) client() (*client.Client, error) {
+	cli, err := client.NewClientWithOpts(client.FromEnv)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create docker client: %w", err)
+	}
+	return cli, nil
+}
+
+func (b *DockerBackend) Inspect(name string) (*ContainerInfo, error) {
+	cli, err := b.client()
+	if err != nil {
+		return nil, err
+	}
+
+	ctx := context.Background()
+	containerJSON, err := cli.ContainerInspect(ctx, name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to inspect container: %w", err)
+	}
+
+	runtimeName := containerJSON.HostConfig.Runtime
+	if runtimeName == "" {
+		runtimeName = "runc"
+	}
+
+	pid := containerJSON.State.Pid
+
+	info := &ContainerInfo{
+		ID:         containerJSON.ID[:12],
+		Name:       strings.TrimPrefix(containerJSON.Name, "/"),
+		PID:        pid,
+		State:      containerJSON.State.Status,
+		RootFS:     containerJSON.GraphDriver.Data["MergedDir"],
+		Runtime:    runtimeName,
+		BundlePath: fmt.Sprintf("/run/docker/runtime-%s/moby/%s", runtimeName, containerJSON.ID),
+		CgroupPath: containerJSON.HostConfig.CgroupParent,
+		Namespaces: make(map[string]string),
+		UsernsMode: string(containerJSON.HostConfig.UsernsMode),
+		Config:     containerJSON.Config,
+		HostConfig: containerJSON.HostConfig,
+	}
+
+	if pid != 0 {
+		for _, ns := range []string{"ipc", "mnt", "net", "pid", "user", "uts", "cgroup"} {
+			info.Namespaces[ns] = fmt.Sprintf("/proc/%d/ns/%s", pid, ns)
+		}
+	}
+
+	return info, nil
+}
+
+func (b *DockerBackend) CreateForRestore(orig, new string) error {
+	cli, err := b.client()
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+
+	originalInspect, err := cli.ContainerInspect(ctx, orig)
+	if err != nil {
+		// Original container is gone (e.g. we're restoring from an image
+		// pulled onto a fresh host); fall back to a bare container that
+		// CRIU can still restore the process tree into.
+		return createBasicContainer(cli, ctx, new)
+	}
+
+	config := originalInspect.Config
+	hostConfig := originalInspect.HostConfig
+	config.Hostname = new
+
+	if _, err := cli.ContainerCreate(ctx, config, hostConfig, nil, nil, new); err != nil {
+		return fmt.Errorf("failed to create container: %w", err)
+	}
+
+	return nil
+}
+
+// createBasicContainer creates a bare alpine container that CRIU can
+// restore a process tree into when the original container's configuration
+// is unavailable.
+func createBasicContainer(cli *client.Client, ctx context.Context, name string) error {
+	_, err := cli.ContainerCreate(ctx, &container.Config{
+		Image: "alpine:latest",
+		Cmd:   []string{"sleep", "infinity"},
+	}, &container.HostConfig{
+		Privileged: true,
+		PidMode:    "host",
+	}, nil, nil, name)
+
+	if err != nil {
+		return fmt.Errorf("failed to create basic container: %w", err)
+	}
+
+	return nil
+}
+
+// NotifyCheckpointComplete is a no-op for Docker: the daemon observes the
+// checkpointed process exiting (or staying alive with -leave-running) on
+// its own and updates container state accordingly.
+func (b *DockerBackend) NotifyCheckpointComplete(id string) error {
+	return nil
+}
+
+// NotifyRestoreComplete is a no-op for Docker, for the same reason.
+func (b *DockerBackend) NotifyRestoreComplete(id string, pid int) error {
+	return nil
+}
@@ -0,0 +1,117 @@
+package runtime
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// ociSpec is the small subset of the OCI runtime-spec config.json this
+// backend needs; it deliberately doesn't pull in a full spec library since
+// all it does is locate the rootfs and read the container's declared
+// namespaces.
+type ociSpec struct {
+	Root struct {
+		Path string `json:"path"`
+	} `json:"root"`
+	Linux struct {
+		Namespaces []struct {
+			Type string `json:"type"`
+		} `json:"namespaces"`
+		CgroupsPath string `json:"cgroupsPath"`
+	} `json:"linux"`
+}
+
+// RuncBackend drives checkpoint/restore against a bare runc/crun bundle on
+// disk, without depending on any daemon. name is treated as the bundle
+// directory (the one containing config.json and state.json), which is how
+// rootless podman and CRI-O invoke runc directly.
+type RuncBackend struct{}
+
+// NewRuncBackend returns a Backend that reads bundles straight off disk.
+func NewRuncBackend() *RuncBackend {
+	return &RuncBackend{}
+}
+
+func (b *RuncBackend) Inspect(bundlePath string) (*ContainerInfo, error) {
+	specData, err := os.ReadFile(filepath.Join(bundlePath, "config.json"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read bundle config.json: %w", err)
+	}
+
+	var spec ociSpec
+	if err := json.Unmarshal(specData, &spec); err != nil {
+		return nil, fmt.Errorf("failed to parse bundle config.json: %w", err)
+	}
+
+	pid, err := readRuncPid(bundlePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to determine container pid: %w", err)
+	}
+
+	info := &ContainerInfo{
+		ID:         filepath.Base(bundlePath),
+		Name:       filepath.Base(bundlePath),
+		PID:        pid,
+		State:      "running",
+		RootFS:     resolveRootFS(bundlePath, spec.Root.Path),
+		Runtime:    "runc",
+		BundlePath: bundlePath,
+		CgroupPath: spec.Linux.CgroupsPath,
+		Namespaces: make(map[string]string),
+		Config:     &spec,
+	}
+
+	if pid != 0 {
+		for _, ns := range spec.Linux.Namespaces {
+			info.Namespaces[ns.Type] = fmt.Sprintf("/proc/%d/ns/%s", pid, ns.Type)
+		}
+	}
+
+	return info, nil
+}
+
+// readRuncPid reads the pid runc recorded for the bundle's init process out
+// of state.json, the same file `runc state` itself reads.
+func readRuncPid(bundlePath string) (int, error) {
+	stateData, err := os.ReadFile(filepath.Join(bundlePath, "state.json"))
+	if err != nil {
+		return 0, err
+	}
+
+	var state struct {
+		Pid int `json:"init_process_pid"`
+	}
+	if err := json.Unmarshal(stateData, &state); err != nil {
+		return 0, err
+	}
+
+	return state.Pid, nil
+}
+
+// CreateForRestore doesn't create anything: CRIU's restore recreates the
+// process directly, and there's no daemon to pre-create a stopped
+// placeholder for. The caller is expected to have a bundle directory for
+// new already in place (e.g. copied from orig, with config.json rewritten
+// for the new name) before calling Restore; it used to silently accept a
+// missing bundle and let the failure surface deep inside the subsequent
+// Inspect call, so check for it here instead and fail with an actionable
+// error up front.
+func (b *RuncBackend) CreateForRestore(orig, new string) error {
+	configPath := filepath.Join(new, "config.json")
+	if _, err := os.Stat(configPath); err != nil {
+		return fmt.Errorf("bundle %q has no config.json: the runc backend requires the restore bundle to already exist (e.g. copied from %q and rewritten for the new name) before restoring: %w", new, orig, err)
+	}
+	return nil
+}
+
+// NotifyCheckpointComplete is a no-op: there's no daemon to tell.
+func (b *RuncBackend) NotifyCheckpointComplete(id string) error {
+	return nil
+}
+
+// NotifyRestoreComplete is a no-op for the same reason.
+func (b *RuncBackend) NotifyRestoreComplete(id string, pid int) error {
+	return nil
+}